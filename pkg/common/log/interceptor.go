@@ -0,0 +1,65 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"context"
+	"path"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+)
+
+// volumeIDRequest is implemented by CSI request types that carry a single
+// volume/snapshot ID, which covers the vast majority of the RPCs we care
+// about tracing. Requests that don't implement it just don't get a
+// "volume=" field in their log lines.
+type volumeIDRequest interface {
+	GetVolumeId() string
+}
+
+// NewServerInterceptor returns a csi-common style unary gRPC interceptor
+// that logs every request/response and injects method/volume/request-id
+// context values so DefaultLog/TraceLog/DebugLog/ErrorLog calls made
+// while handling the RPC automatically pick up a consistent prefix.
+func NewServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+
+		ctx = WithMethod(ctx, path.Base(info.FullMethod))
+		ctx = WithRequestID(ctx, uuid.New().String())
+
+		if v, ok := req.(volumeIDRequest); ok {
+			ctx = WithVolumeID(ctx, v.GetVolumeId())
+		}
+
+		TraceLog(ctx, "request: %+v", req)
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			ErrorLog(ctx, "failed: %s", err.Error())
+		} else {
+			TraceLog(ctx, "response: %+v", resp)
+		}
+
+		return resp, err
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package log wraps klog with request-scoped fields (CSI method, volume
+// ID, request UUID) pulled out of a context.Context, so every RPC gets a
+// consistent, greppable log prefix without each call site having to
+// thread those fields through by hand.
+package log
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/klog"
+)
+
+type contextKey string
+
+const (
+	methodKey    contextKey = "csi.method"
+	volumeIDKey  contextKey = "csi.volumeID"
+	requestIDKey contextKey = "csi.requestID"
+)
+
+// WithMethod returns a context tagged with the CSI RPC method name, e.g.
+// "/csi.v1.Controller/CreateVolume".
+func WithMethod(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, methodKey, method)
+}
+
+// WithVolumeID returns a context tagged with the volume (or snapshot) ID
+// the current RPC is operating on.
+func WithVolumeID(ctx context.Context, volumeID string) context.Context {
+	return context.WithValue(ctx, volumeIDKey, volumeID)
+}
+
+// WithRequestID returns a context tagged with a request-scoped UUID, set
+// once per RPC by the logging interceptor.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// prefix renders whatever request-scoped fields are present on ctx as a
+// log-line prefix, e.g. "[method=CreateVolume volume=pvc-123 req=ab12cd]".
+func prefix(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	var out string
+	if v, ok := ctx.Value(methodKey).(string); ok && v != "" {
+		out += fmt.Sprintf("method=%s ", v)
+	}
+	if v, ok := ctx.Value(volumeIDKey).(string); ok && v != "" {
+		out += fmt.Sprintf("volume=%s ", v)
+	}
+	if v, ok := ctx.Value(requestIDKey).(string); ok && v != "" {
+		out += fmt.Sprintf("req=%s ", v)
+	}
+
+	if out == "" {
+		return ""
+	}
+	return "[" + out[:len(out)-1] + "] "
+}
+
+// DefaultLog logs at klog's default (Info) verbosity, prefixed with any
+// request-scoped fields found on ctx.
+func DefaultLog(ctx context.Context, format string, args ...interface{}) {
+	klog.Infof(prefix(ctx)+format, args...)
+}
+
+// TraceLog logs at a high verbosity level intended for step-by-step RPC
+// tracing, prefixed with any request-scoped fields found on ctx.
+func TraceLog(ctx context.Context, format string, args ...interface{}) {
+	klog.V(4).Infof(prefix(ctx)+format, args...)
+}
+
+// DebugLog logs at a verbosity level intended for developer debugging,
+// prefixed with any request-scoped fields found on ctx.
+func DebugLog(ctx context.Context, format string, args ...interface{}) {
+	klog.V(2).Infof(prefix(ctx)+format, args...)
+}
+
+// ErrorLog logs an error, prefixed with any request-scoped fields found
+// on ctx.
+func ErrorLog(ctx context.Context, format string, args ...interface{}) {
+	klog.Errorf(prefix(ctx)+format, args...)
+}
@@ -14,7 +14,7 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package driver
+package controller
 
 import (
 	"fmt"
@@ -26,12 +26,12 @@ import (
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	"k8s.io/klog"
 
 	"github.com/openebs/zfs-localpv/pkg/builder/snapbuilder"
 	"github.com/openebs/zfs-localpv/pkg/builder/volbuilder"
 	errors "github.com/openebs/zfs-localpv/pkg/common/errors"
 	"github.com/openebs/zfs-localpv/pkg/common/helpers"
+	"github.com/openebs/zfs-localpv/pkg/common/log"
 	csipayload "github.com/openebs/zfs-localpv/pkg/response"
 	schd "github.com/openebs/zfs-localpv/pkg/scheduler"
 	analytics "github.com/openebs/zfs-localpv/pkg/usage"
@@ -46,19 +46,32 @@ const (
 	Gi = 1024 * 1024 * 1024
 )
 
+// Config holds the bits of driver identity the controller server needs.
+// It is deliberately just the fields this package uses, rather than the
+// top-level driver.CSIDriver struct itself, so that pkg/driver/controller
+// never has to import pkg/driver and the two can't end up in an import
+// cycle as more subsystems (KMS, scheduler, metrics) get added. Node
+// identity (NodeID) belongs to pkg/driver/node.Config instead - the
+// controller server never needs it.
+type Config struct {
+	Name string
+}
+
 // controller is the server implementation
 // for CSI Controller
 type controller struct {
-	driver       *CSIDriver
+	config       *Config
 	capabilities []*csi.ControllerServiceCapability
+	volumeLocks  *VolumeLocks
 }
 
 // NewController returns a new instance
 // of CSI controller
-func NewController(d *CSIDriver) csi.ControllerServer {
+func NewController(c *Config) csi.ControllerServer {
 	return &controller{
-		driver:       d,
+		config:       c,
 		capabilities: newControllerCapabilities(),
+		volumeLocks:  NewVolumeLocks(),
 	}
 }
 
@@ -101,7 +114,7 @@ func getRoundedCapacity(size int64) int64 {
 }
 
 // CreateZFSVolume create new zfs volume from csi volume request
-func CreateZFSVolume(req *csi.CreateVolumeRequest) (string, error) {
+func CreateZFSVolume(ctx context.Context, req *csi.CreateVolumeRequest) (string, error) {
 	volName := req.GetName()
 	size := getRoundedCapacity(req.GetCapacityRange().RequiredBytes)
 
@@ -119,6 +132,7 @@ func CreateZFSVolume(req *csi.CreateVolumeRequest) (string, error) {
 	encr := parameters["encryption"]
 	kf := parameters["keyformat"]
 	kl := parameters["keylocation"]
+	kmsName := parameters["encryptionkms"]
 	pool := parameters["poolname"]
 	tp := parameters["thinprovision"]
 	schld := parameters["scheduler"]
@@ -133,13 +147,26 @@ func CreateZFSVolume(req *csi.CreateVolumeRequest) (string, error) {
 	}
 
 	// run the scheduler
-	selected := schd.Scheduler(req, nmap)
+	selected := schd.Scheduler(req, nmap, schld)
 
 	if len(selected) == 0 {
 		return "", status.Error(codes.Internal, "scheduler failed")
 	}
 
-	klog.Infof("scheduled the volume %s/%s on node %s", pool, volName, selected)
+	log.DefaultLog(ctx, "scheduled the volume %s/%s on node %s", pool, volName, selected)
+
+	// when encryptionKMS names a configured KMS backend it takes over
+	// from the raw keyformat/keylocation params : the DEK is fetched from
+	// the backend and staged on the owner node instead of requiring the
+	// operator to pre-stage a key file on every node
+	if kmsName != "" {
+		keyLocation, err := resolveEncryptionKey(ctx, kmsName, volName)
+		if err != nil {
+			return "", status.Error(codes.Internal, err.Error())
+		}
+		kf = "raw"
+		kl = keyLocation
+	}
 
 	volObj, err := volbuilder.NewBuilder().
 		WithName(volName).
@@ -173,7 +200,7 @@ func CreateZFSVolume(req *csi.CreateVolumeRequest) (string, error) {
 }
 
 // CreateVolClone creates the clone from a volume
-func CreateVolClone(req *csi.CreateVolumeRequest, srcVol string) (string, error) {
+func CreateVolClone(ctx context.Context, req *csi.CreateVolumeRequest, srcVol string) (string, error) {
 	volName := req.GetName()
 	parameters := req.GetParameters()
 	// lower case keys, cf CreateZFSVolume()
@@ -221,7 +248,7 @@ func CreateVolClone(req *csi.CreateVolumeRequest, srcVol string) (string, error)
 }
 
 // CreateSnapClone creates the clone from a snapshot
-func CreateSnapClone(req *csi.CreateVolumeRequest, snapshot string) (string, error) {
+func CreateSnapClone(ctx context.Context, req *csi.CreateVolumeRequest, snapshot string) (string, error) {
 
 	volName := req.GetName()
 	parameters := req.GetParameters()
@@ -295,15 +322,20 @@ func (cs *controller) CreateVolume(
 		return nil, err
 	}
 
+	if acquired := cs.volumeLocks.TryAcquire(volName); !acquired {
+		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, volName)
+	}
+	defer cs.volumeLocks.Release(volName)
+
 	if contentSource != nil && contentSource.GetSnapshot() != nil {
 		snapshotID := contentSource.GetSnapshot().GetSnapshotId()
 
-		selected, err = CreateSnapClone(req, snapshotID)
+		selected, err = CreateSnapClone(ctx, req, snapshotID)
 	} else if contentSource != nil && contentSource.GetVolume() != nil {
 		srcVol := contentSource.GetVolume().GetVolumeId()
-		selected, err = CreateVolClone(req, srcVol)
+		selected, err = CreateVolClone(ctx, req, srcVol)
 	} else {
-		selected, err = CreateZFSVolume(req)
+		selected, err = CreateZFSVolume(ctx, req)
 	}
 
 	if err != nil {
@@ -314,6 +346,12 @@ func (cs *controller) CreateVolume(
 
 	topology := map[string]string{zfs.ZFSTopologyKey: selected}
 	cntx := map[string]string{zfs.PoolNameKey: pool}
+	if kmsName := helpers.GetInsensitiveParameter(&parameters, "encryptionkms"); kmsName != "" {
+		// passed through so NodeStageVolume knows to stage this
+		// volume's key before the dataset gets created, see
+		// pkg/driver/node/encryption.go
+		cntx[zfs.EncryptionKMSKey] = kmsName
+	}
 
 	return csipayload.NewCreateVolumeResponseBuilder().
 		WithName(volName).
@@ -329,7 +367,7 @@ func (cs *controller) DeleteVolume(
 	ctx context.Context,
 	req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
 
-	klog.Infof("received request to delete volume {%s}", req.VolumeId)
+	log.DefaultLog(ctx, "received request to delete volume {%s}", req.VolumeId)
 
 	var (
 		err error
@@ -341,6 +379,11 @@ func (cs *controller) DeleteVolume(
 
 	volumeID := req.GetVolumeId()
 
+	if acquired := cs.volumeLocks.TryAcquire(volumeID); !acquired {
+		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, volumeID)
+	}
+	defer cs.volumeLocks.Release(volumeID)
+
 	// verify if the volume has already been deleted
 	vol, err := zfs.GetVolume(volumeID)
 	if vol != nil && vol.DeletionTimestamp != nil {
@@ -407,6 +450,11 @@ func (cs *controller) ControllerExpandVolume(
 	req *csi.ControllerExpandVolumeRequest,
 ) (*csi.ControllerExpandVolumeResponse, error) {
 
+	if acquired := cs.volumeLocks.TryAcquire(req.VolumeId); !acquired {
+		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, req.VolumeId)
+	}
+	defer cs.volumeLocks.Release(req.VolumeId)
+
 	/* round off the new size */
 	updatedSize := getRoundedCapacity(req.GetCapacityRange().GetRequiredBytes())
 
@@ -462,7 +510,13 @@ func (cs *controller) CreateSnapshot(
 	req *csi.CreateSnapshotRequest,
 ) (*csi.CreateSnapshotResponse, error) {
 
-	klog.Infof("CreateSnapshot volume %s@%s", req.SourceVolumeId, req.Name)
+	log.DefaultLog(ctx, "CreateSnapshot volume %s@%s", req.SourceVolumeId, req.Name)
+
+	snapID := req.SourceVolumeId + "@" + req.Name
+	if acquired := cs.volumeLocks.TryAcquire(snapID); !acquired {
+		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, snapID)
+	}
+	defer cs.volumeLocks.Release(snapID)
 
 	snapTimeStamp := time.Now().Unix()
 	state, err := zfs.GetZFSSnapshotStatus(req.Name)
@@ -531,7 +585,12 @@ func (cs *controller) DeleteSnapshot(
 	req *csi.DeleteSnapshotRequest,
 ) (*csi.DeleteSnapshotResponse, error) {
 
-	klog.Infof("DeleteSnapshot request for %s", req.SnapshotId)
+	log.DefaultLog(ctx, "DeleteSnapshot request for %s", req.SnapshotId)
+
+	if acquired := cs.volumeLocks.TryAcquire(req.SnapshotId); !acquired {
+		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, req.SnapshotId)
+	}
+	defer cs.volumeLocks.Release(req.SnapshotId)
 
 	// snapshodID is formed as <volname>@<snapname>
 	// parsing them here
@@ -556,7 +615,9 @@ func (cs *controller) DeleteSnapshot(
 }
 
 // ListSnapshots lists all snapshots for the
-// given volume
+// given volume, or all snapshots known to the cluster if no
+// SourceVolumeId is given. Results are paged via max_entries/next_token
+// so the external-snapshotter can page through large clusters.
 //
 // This implements csi.ControllerServer
 func (cs *controller) ListSnapshots(
@@ -564,7 +625,63 @@ func (cs *controller) ListSnapshots(
 	req *csi.ListSnapshotsRequest,
 ) (*csi.ListSnapshotsResponse, error) {
 
-	return nil, status.Error(codes.Unimplemented, "")
+	tok, err := decodeListToken(req.GetStartingToken())
+	if err != nil {
+		return nil, err
+	}
+
+	snaps, err := zfs.ListZFSSnapshots()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ListSnapshots: failed to list ZFSSnapshots : %s", err.Error())
+	}
+
+	if tok.resourceVersion != "" && tok.resourceVersion != snaps.ResourceVersion {
+		return nil, status.Error(codes.Aborted, "ListSnapshots: starting_token is stale, cache has moved on")
+	}
+
+	entries := snaps.Items
+	if srcVol := req.GetSourceVolumeId(); srcVol != "" {
+		filtered := entries[:0]
+		for _, snap := range entries {
+			if snap.Labels[zfs.ZFSVolKey] == srcVol {
+				filtered = append(filtered, snap)
+			}
+		}
+		entries = filtered
+	}
+
+	if tok.offset > len(entries) {
+		return nil, status.Errorf(codes.Aborted, "ListSnapshots: starting_token offset %d out of range", tok.offset)
+	}
+
+	maxEntries := int(req.GetMaxEntries())
+	if maxEntries <= 0 {
+		maxEntries = len(entries)
+	}
+
+	end := tok.offset + maxEntries
+	if end > len(entries) {
+		end = len(entries)
+	}
+
+	resp := &csi.ListSnapshotsResponse{}
+	for _, snap := range entries[tok.offset:end] {
+		size, _ := strconv.ParseInt(snap.Spec.Capacity, 10, 64)
+		resp.Entries = append(resp.Entries, &csi.ListSnapshotsResponse_Entry{
+			Snapshot: &csi.Snapshot{
+				SizeBytes:      size,
+				SnapshotId:     snap.Labels[zfs.ZFSVolKey] + "@" + snap.Name,
+				SourceVolumeId: snap.Labels[zfs.ZFSVolKey],
+				ReadyToUse:     snap.Status.State == zfs.ZFSStatusReady,
+			},
+		})
+	}
+
+	if end < len(entries) {
+		resp.NextToken = encodeListToken(snaps.ResourceVersion, end)
+	}
+
+	return resp, nil
 }
 
 // ControllerUnpublishVolume removes a previously
@@ -591,8 +708,10 @@ func (cs *controller) ControllerPublishVolume(
 	return nil, status.Error(codes.Unimplemented, "")
 }
 
-// GetCapacity return the capacity of the
-// given volume
+// GetCapacity returns the available capacity, in bytes, for the pool
+// named by the "poolname" parameter, summed across the nodes matching the
+// request's accessibility requirements. This lets the external-provisioner
+// honor StorageCapacity and skip nodes/pools that can't fit the PVC.
 //
 // This implements csi.ControllerServer
 func (cs *controller) GetCapacity(
@@ -600,10 +719,38 @@ func (cs *controller) GetCapacity(
 	req *csi.GetCapacityRequest,
 ) (*csi.GetCapacityResponse, error) {
 
-	return nil, status.Error(codes.Unimplemented, "")
+	parameters := req.GetParameters()
+	pool := helpers.GetInsensitiveParameter(&parameters, "poolname")
+	if pool == "" {
+		return nil, status.Error(codes.InvalidArgument, "GetCapacity: poolname parameter is required")
+	}
+
+	nmap, err := schd.FreeBytesByNode(pool)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "GetCapacity: failed to get pool stats : %s", err.Error())
+	}
+
+	var allowedNode string
+	var hasTopology bool
+	if topology := req.GetAccessibleTopology(); topology != nil {
+		allowedNode, hasTopology = topology.GetSegments()[zfs.ZFSTopologyKey]
+	}
+
+	var available int64
+	for node, free := range nmap {
+		if hasTopology && node != allowedNode {
+			continue
+		}
+		available += free
+	}
+
+	return &csi.GetCapacityResponse{AvailableCapacity: available}, nil
 }
 
-// ListVolumes lists all the volumes
+// ListVolumes lists all the volumes known to the cluster, paged via
+// max_entries/next_token, along with a VolumeCondition derived from the
+// ZV's status so the health-monitor sidecar can surface degraded volumes
+// without a separate round-trip.
 //
 // This implements csi.ControllerServer
 func (cs *controller) ListVolumes(
@@ -611,7 +758,80 @@ func (cs *controller) ListVolumes(
 	req *csi.ListVolumesRequest,
 ) (*csi.ListVolumesResponse, error) {
 
-	return nil, status.Error(codes.Unimplemented, "")
+	tok, err := decodeListToken(req.GetStartingToken())
+	if err != nil {
+		return nil, err
+	}
+
+	vols, err := zfs.ListZFSVolumes()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ListVolumes: failed to list ZFSVolumes : %s", err.Error())
+	}
+
+	if tok.resourceVersion != "" && tok.resourceVersion != vols.ResourceVersion {
+		return nil, status.Error(codes.Aborted, "ListVolumes: starting_token is stale, cache has moved on")
+	}
+
+	entries := vols.Items
+	if tok.offset > len(entries) {
+		return nil, status.Errorf(codes.Aborted, "ListVolumes: starting_token offset %d out of range", tok.offset)
+	}
+
+	maxEntries := int(req.GetMaxEntries())
+	if maxEntries <= 0 {
+		maxEntries = len(entries)
+	}
+
+	end := tok.offset + maxEntries
+	if end > len(entries) {
+		end = len(entries)
+	}
+
+	resp := &csi.ListVolumesResponse{}
+	for _, vol := range entries[tok.offset:end] {
+		size, _ := strconv.ParseInt(vol.Spec.Capacity, 10, 64)
+		abnormal, message := volumeCondition(vol)
+
+		resp.Entries = append(resp.Entries, &csi.ListVolumesResponse_Entry{
+			Volume: &csi.Volume{
+				VolumeId:      vol.Name,
+				CapacityBytes: size,
+				AccessibleTopology: []*csi.Topology{
+					{Segments: map[string]string{zfs.ZFSTopologyKey: vol.Spec.OwnerNodeID}},
+				},
+			},
+			Status: &csi.ListVolumesResponse_VolumeStatus{
+				PublishedNodeIds: []string{vol.Spec.OwnerNodeID},
+				VolumeCondition: &csi.VolumeCondition{
+					Abnormal: abnormal,
+					Message:  message,
+				},
+			},
+		})
+	}
+
+	if end < len(entries) {
+		resp.NextToken = encodeListToken(vols.ResourceVersion, end)
+	}
+
+	return resp, nil
+}
+
+// volumeCondition reports a ZFSVolume as abnormal when its ZV is in the
+// Failed state, it is in the process of being torn down, or the owner
+// node's HealthPusher last found its backing dataset missing or
+// otherwise unhealthy (see vol.Status.Health*, pkg/driver/node/health.go).
+func volumeCondition(vol *zfs.ZFSVolume) (bool, string) {
+	if vol.DeletionTimestamp != nil {
+		return true, fmt.Sprintf("zfs volume %s is terminating", vol.Name)
+	}
+	if vol.Status.State == zfs.ZFSStatusFailed {
+		return true, fmt.Sprintf("zfs volume %s is in Failed state", vol.Name)
+	}
+	if vol.Status.HealthAbnormal {
+		return true, vol.Status.HealthMessage
+	}
+	return false, ""
 }
 
 // validateCapabilities validates if provided capabilities
@@ -682,6 +902,11 @@ func newControllerCapabilities() []*csi.ControllerServiceCapability {
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
 		csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+		csi.ControllerServiceCapability_RPC_GET_VOLUME,
+		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
 	} {
 		capabilities = append(capabilities, fromType(cap))
 	}
@@ -702,7 +927,7 @@ func (cs *controller) validateRequest(
 
 	return status.Error(
 		codes.InvalidArgument,
-		fmt.Sprintf("failed to validate request: {%s} is not supported", c),
+		fmt.Sprintf("failed to validate request: {%s} is not supported by %s", c, cs.config.Name),
 	)
 }
 
@@ -0,0 +1,49 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openebs/zfs-localpv/pkg/kms"
+	zfs "github.com/openebs/zfs-localpv/pkg/zfs"
+)
+
+// resolveEncryptionKey validates that the `encryptionKMS` StorageClass
+// parameter names a backend configured in the cluster-wide kms
+// ConfigMap, and returns the deterministic tmpfs keylocation CreateVolume
+// bakes into the ZFSVolume spec as `keyformat=raw keylocation=file://...`.
+//
+// It deliberately does not fetch or stage the key itself: the controller
+// isn't guaranteed to be running on the volume's owner node, so the
+// actual key material is derived and written to that file by the node's
+// pkg/driver/node KeyReconciler (see node/encryption.go), which resolves
+// the same (kmsName, volName) pair via kms.Resolve independently. This
+// returns ("", nil) when kmsName is empty, so callers fall back to the
+// StorageClass's raw keyformat/keylocation, if any.
+func resolveEncryptionKey(ctx context.Context, kmsName, volName string) (string, error) {
+	if kmsName == "" {
+		return "", nil
+	}
+
+	if _, err := kms.LoadFromConfigMap(ctx, kmsName); err != nil {
+		return "", fmt.Errorf("resolve encryption key for %s : %s", volName, err.Error())
+	}
+
+	return zfs.KeyLocation(volName), nil
+}
@@ -0,0 +1,70 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strconv"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	zfs "github.com/openebs/zfs-localpv/pkg/zfs"
+)
+
+// ControllerGetVolume reports a ZFSVolume's health for the
+// external-health-monitor sidecar to surface as PVC events. The
+// VolumeCondition combines the ZV's own status (Failed/terminating/
+// missing dataset) with the dataset-level verdict that the volume's
+// owner node last pushed to vol.Status.Health* - the controller process
+// has no business probing ZFS on a host it doesn't own, so it only ever
+// reads what pkg/driver/node's HealthPusher wrote there.
+//
+// This implements csi.ControllerServer
+func (cs *controller) ControllerGetVolume(
+	ctx context.Context,
+	req *csi.ControllerGetVolumeRequest,
+) (*csi.ControllerGetVolumeResponse, error) {
+
+	volumeID := req.GetVolumeId()
+	if volumeID == "" {
+		return nil, status.Error(codes.InvalidArgument, "ControllerGetVolume: missing volume id")
+	}
+
+	vol, err := zfs.GetZFSVolume(volumeID)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "ControllerGetVolume: %s", err.Error())
+	}
+
+	abnormal, message := volumeCondition(vol)
+
+	size, _ := strconv.ParseInt(vol.Spec.Capacity, 10, 64)
+
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      vol.Name,
+			CapacityBytes: size,
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			VolumeCondition: &csi.VolumeCondition{
+				Abnormal: abnormal,
+				Message:  message,
+			},
+		},
+	}, nil
+}
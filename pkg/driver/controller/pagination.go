@@ -0,0 +1,72 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// listToken captures where a paged ListVolumes/ListSnapshots call left
+// off : the resourceVersion of the informer cache listing it was built
+// from, plus how many of its entries had already been returned. Carrying
+// the resourceVersion lets a later call notice the cache moved on and
+// reject the token instead of silently skipping or repeating entries.
+type listToken struct {
+	resourceVersion string
+	offset          int
+}
+
+// encodeListToken packs a listToken into the opaque next_token string
+// handed back to CSI callers (external-snapshotter, health-monitor, etc)
+// so they can resume a paged listing.
+func encodeListToken(resourceVersion string, offset int) string {
+	raw := fmt.Sprintf("%s:%d", resourceVersion, offset)
+	return base64.StdEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeListToken reverses encodeListToken. An empty token decodes to the
+// zero listToken (start from the beginning); anything else that doesn't
+// parse as one of ours is rejected per the CSI spec's requirement to
+// error out on an invalid starting_token.
+func decodeListToken(token string) (listToken, error) {
+	if token == "" {
+		return listToken{}, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return listToken{}, status.Errorf(codes.Aborted, "invalid starting_token %q : %s", token, err.Error())
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return listToken{}, status.Errorf(codes.Aborted, "invalid starting_token %q", token)
+	}
+
+	offset, err := strconv.Atoi(parts[1])
+	if err != nil || offset < 0 {
+		return listToken{}, status.Errorf(codes.Aborted, "invalid starting_token %q", token)
+	}
+
+	return listToken{resourceVersion: parts[0], offset: offset}, nil
+}
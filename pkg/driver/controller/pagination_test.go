@@ -0,0 +1,88 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestEncodeDecodeListTokenRoundTrip checks that a token survives the
+// encode/decode round trip a paged ListVolumes call relies on.
+func TestEncodeDecodeListTokenRoundTrip(t *testing.T) {
+	encoded := encodeListToken("12345", 7)
+
+	tok, err := decodeListToken(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if tok.resourceVersion != "12345" || tok.offset != 7 {
+		t.Fatalf("expected {12345 7}, got %+v", tok)
+	}
+}
+
+// TestDecodeListTokenEmpty checks that an empty starting_token (the
+// first page of a listing) decodes to the zero token rather than erroring.
+func TestDecodeListTokenEmpty(t *testing.T) {
+	tok, err := decodeListToken("")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if tok.resourceVersion != "" || tok.offset != 0 {
+		t.Fatalf("expected zero token, got %+v", tok)
+	}
+}
+
+// TestDecodeListTokenInvalid checks that tokens that aren't valid
+// base64, don't contain the "resourceVersion:offset" separator, or carry
+// a non-numeric/negative offset are all rejected with codes.Aborted, per
+// the CSI spec's requirement to error out on an invalid starting_token.
+func TestDecodeListTokenInvalid(t *testing.T) {
+	cases := []string{
+		"not-valid-base64!!!",
+		base64.StdEncoding.EncodeToString([]byte("missing-separator")),
+		base64.StdEncoding.EncodeToString([]byte("12345:not-a-number")),
+		base64.StdEncoding.EncodeToString([]byte("12345:-1")),
+	}
+
+	for _, tok := range cases {
+		_, err := decodeListToken(tok)
+		st, ok := status.FromError(err)
+		if !ok || st.Code() != codes.Aborted {
+			t.Fatalf("token %q: expected codes.Aborted, got %v", tok, err)
+		}
+	}
+}
+
+// TestDecodeListTokenOffsetEqualsLength checks the boundary case used by
+// ListVolumes when a starting_token picks up exactly where the previous
+// page's NextToken left off : offset == len(entries) is a valid, empty
+// final page, not an out-of-range error.
+func TestDecodeListTokenOffsetEqualsLength(t *testing.T) {
+	const entryCount = 3
+
+	tok, err := decodeListToken(encodeListToken("rv-1", entryCount))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if tok.offset > entryCount {
+		t.Fatalf("offset %d should not be treated as out of range for %d entries", tok.offset, entryCount)
+	}
+}
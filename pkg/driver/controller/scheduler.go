@@ -0,0 +1,35 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	schd "github.com/openebs/zfs-localpv/pkg/scheduler"
+	zfs "github.com/openebs/zfs-localpv/pkg/zfs"
+)
+
+// getNodeMap builds the candidate node -> value map that schd.Scheduler
+// picks from. For the default "spread" mode the value is the number of
+// ZFSVolumes already provisioned on that node for the given pool; for
+// "capacity" mode it is the free bytes last reported by the node's
+// pool-stat collector, so that scheduling honors actual free space rather
+// than just volume count.
+func getNodeMap(schld, pool string) (map[string]int64, error) {
+	if schld == schd.ScheduleCapacity {
+		return schd.FreeBytesByNode(pool)
+	}
+	return zfs.GetVolCountByNode(pool)
+}
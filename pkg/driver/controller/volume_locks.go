@@ -0,0 +1,66 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// volumeOperationAlreadyExistsFmt is the standard CSI idempotency message
+// returned when a second RPC comes in for a key that already has one
+// in-flight, cf the CSI spec's guidance on concurrent identical requests.
+const volumeOperationAlreadyExistsFmt = "an operation with the given key %s already exists"
+
+// VolumeLocks is a mutex-guarded set of keys (volume name, snapshot name,
+// or source-volume+snapname) with an in-flight CSI RPC. It is used to
+// serialize concurrent operations on the same volume/snapshot so that,
+// for example, two concurrent CreateVolume calls for the same name cannot
+// both race through ProvisionVolume and create duplicate ZV CRs.
+type VolumeLocks struct {
+	locks sets.String
+	mux   sync.Mutex
+}
+
+// NewVolumeLocks returns an empty VolumeLocks ready to use.
+func NewVolumeLocks() *VolumeLocks {
+	return &VolumeLocks{
+		locks: sets.NewString(),
+	}
+}
+
+// TryAcquire locks the given key if it is not already locked, and returns
+// true. If the key is already locked it returns false without blocking.
+func (vl *VolumeLocks) TryAcquire(key string) bool {
+	vl.mux.Lock()
+	defer vl.mux.Unlock()
+
+	if vl.locks.Has(key) {
+		return false
+	}
+	vl.locks.Insert(key)
+	return true
+}
+
+// Release unlocks the given key.
+func (vl *VolumeLocks) Release(key string) {
+	vl.mux.Lock()
+	defer vl.mux.Unlock()
+
+	vl.locks.Delete(key)
+}
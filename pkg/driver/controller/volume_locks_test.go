@@ -0,0 +1,157 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newTestController returns a controller with no ZFS backing, suitable
+// only for exercising the volumeLocks guard at the top of each RPC - any
+// request that gets past the lock check and into the zfs package will
+// fail in this test setup.
+func newTestController() *controller {
+	return &controller{
+		config:       &Config{Name: "zfs-localpv-test"},
+		capabilities: newControllerCapabilities(),
+		volumeLocks:  NewVolumeLocks(),
+	}
+}
+
+// TestVolumeLocksTryAcquireSingleWinner fires a batch of concurrent
+// TryAcquire calls for the same key, as two racing CSI RPCs would, and
+// asserts that exactly one of them wins the lock.
+func TestVolumeLocksTryAcquireSingleWinner(t *testing.T) {
+	vl := NewVolumeLocks()
+
+	const key = "pvc-1234"
+	const concurrency = 20
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	acquired := 0
+
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			if vl.TryAcquire(key) {
+				mu.Lock()
+				acquired++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 1 {
+		t.Fatalf("expected exactly 1 goroutine to acquire the lock, got %d", acquired)
+	}
+}
+
+// TestVolumeLocksReleaseAllowsReacquire checks that releasing a key makes
+// it available again, e.g. after an RPC finishes handling a volume.
+func TestVolumeLocksReleaseAllowsReacquire(t *testing.T) {
+	vl := NewVolumeLocks()
+
+	const key = "pvc-5678"
+
+	if !vl.TryAcquire(key) {
+		t.Fatalf("expected first TryAcquire to succeed")
+	}
+	if vl.TryAcquire(key) {
+		t.Fatalf("expected second TryAcquire to fail while key is held")
+	}
+
+	vl.Release(key)
+
+	if !vl.TryAcquire(key) {
+		t.Fatalf("expected TryAcquire to succeed after Release")
+	}
+}
+
+// TestVolumeLocksIndependentKeys checks that locking one key does not
+// block a concurrent operation on a different key.
+func TestVolumeLocksIndependentKeys(t *testing.T) {
+	vl := NewVolumeLocks()
+
+	if !vl.TryAcquire("vol-a") {
+		t.Fatalf("expected to acquire vol-a")
+	}
+	if !vl.TryAcquire("vol-b") {
+		t.Fatalf("expected to acquire vol-b independently of vol-a")
+	}
+}
+
+// TestDeleteVolumeAbortsWhenLockHeld drives the real DeleteVolume RPC
+// against a volume whose lock is already held, as would happen if a
+// second DeleteVolume (or CreateVolume) for the same volume ID raced in
+// while the first was still in flight, and checks that the loser gets
+// back codes.Aborted rather than reaching into the zfs package at all.
+func TestDeleteVolumeAbortsWhenLockHeld(t *testing.T) {
+	cs := newTestController()
+
+	const volumeID = "pvc-locked"
+	if !cs.volumeLocks.TryAcquire(volumeID) {
+		t.Fatalf("setup: expected to acquire %s", volumeID)
+	}
+	defer cs.volumeLocks.Release(volumeID)
+
+	_, err := cs.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{
+		VolumeId: volumeID,
+	})
+
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.Aborted {
+		t.Fatalf("expected codes.Aborted, got %v", err)
+	}
+}
+
+// TestCreateVolumeAbortsWhenLockHeld is the CreateVolume analogue of
+// TestDeleteVolumeAbortsWhenLockHeld: a concurrent CreateVolume for a
+// volume name that's already being operated on must lose with
+// codes.Aborted instead of racing into provisioning.
+func TestCreateVolumeAbortsWhenLockHeld(t *testing.T) {
+	cs := newTestController()
+
+	const volName = "pvc-locked"
+	if !cs.volumeLocks.TryAcquire(volName) {
+		t.Fatalf("setup: expected to acquire %s", volName)
+	}
+	defer cs.volumeLocks.Release(volName)
+
+	_, err := cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+		Name: volName,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+			},
+		},
+	})
+
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.Aborted {
+		t.Fatalf("expected codes.Aborted, got %v", err)
+	}
+}
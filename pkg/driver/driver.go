@@ -0,0 +1,73 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package driver assembles the CSI identity, controller and node servers
+// into a single gRPC server listening on the driver's endpoint.
+package driver
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+
+	"github.com/openebs/zfs-localpv/pkg/common/log"
+	"github.com/openebs/zfs-localpv/pkg/driver/controller"
+	"github.com/openebs/zfs-localpv/pkg/driver/identity"
+	"github.com/openebs/zfs-localpv/pkg/driver/node"
+)
+
+// CSIDriver holds the config needed to stand up the gRPC server; it is
+// the only thing that imports all three of pkg/driver/{identity,
+// controller, node}.
+type CSIDriver struct {
+	Name     string
+	Version  string
+	NodeID   string
+	Endpoint string
+}
+
+// Run starts serving CSI RPCs on d.Endpoint until the process exits. It
+// registers the logging interceptor once here, which is what actually
+// gives every RPC the consistent method/volume/request-id log prefix
+// documented on log.NewServerInterceptor.
+func (d *CSIDriver) Run() error {
+	u, err := url.Parse(d.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	lis, err := net.Listen(u.Scheme, u.Path)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer(grpc.UnaryInterceptor(log.NewServerInterceptor()))
+
+	csi.RegisterIdentityServer(srv, identity.NewIdentity(&identity.Config{
+		Name:    d.Name,
+		Version: d.Version,
+	}))
+	csi.RegisterControllerServer(srv, controller.NewController(&controller.Config{
+		Name: d.Name,
+	}))
+	csi.RegisterNodeServer(srv, node.NewNode(&node.Config{
+		NodeID: d.NodeID,
+	}))
+
+	return srv.Serve(lis)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Config holds the bits of driver identity the identity server needs.
+type Config struct {
+	Name    string
+	Version string
+}
+
+// identity is the server implementation for CSI Identity.
+type identity struct {
+	config       *Config
+	capabilities []*csi.PluginCapability
+}
+
+// NewIdentity returns a new instance of the CSI identity server.
+func NewIdentity(c *Config) csi.IdentityServer {
+	return &identity{
+		config: c,
+		capabilities: []*csi.PluginCapability{
+			{
+				Type: &csi.PluginCapability_Service_{
+					Service: &csi.PluginCapability_Service{
+						Type: csi.PluginCapability_Service_CONTROLLER_SERVICE,
+					},
+				},
+			},
+			{
+				Type: &csi.PluginCapability_VolumeExpansion_{
+					VolumeExpansion: &csi.PluginCapability_VolumeExpansion{
+						Type: csi.PluginCapability_VolumeExpansion_ONLINE,
+					},
+				},
+			},
+		},
+	}
+}
+
+// GetPluginInfo returns the driver's name and version.
+//
+// This implements csi.IdentityServer
+func (id *identity) GetPluginInfo(
+	ctx context.Context,
+	req *csi.GetPluginInfoRequest,
+) (*csi.GetPluginInfoResponse, error) {
+	return &csi.GetPluginInfoResponse{
+		Name:          id.config.Name,
+		VendorVersion: id.config.Version,
+	}, nil
+}
+
+// GetPluginCapabilities declares the plugin-level capabilities of this
+// driver.
+//
+// This implements csi.IdentityServer
+func (id *identity) GetPluginCapabilities(
+	ctx context.Context,
+	req *csi.GetPluginCapabilitiesRequest,
+) (*csi.GetPluginCapabilitiesResponse, error) {
+	return &csi.GetPluginCapabilitiesResponse{
+		Capabilities: id.capabilities,
+	}, nil
+}
+
+// Probe is a liveness check; it always reports ready since there's
+// nothing this process depends on that can't serve a request if it's up.
+//
+// This implements csi.IdentityServer
+func (id *identity) Probe(
+	ctx context.Context,
+	req *csi.ProbeRequest,
+) (*csi.ProbeResponse, error) {
+	return &csi.ProbeResponse{
+		Ready: wrapperspb.Bool(true),
+	}, nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+
+	zfs "github.com/openebs/zfs-localpv/pkg/zfs"
+)
+
+// DefaultPoolStatInterval is how often PoolStatCollector refreshes this
+// node's pool free-space figures and writes them back to its ZFSNode CR.
+const DefaultPoolStatInterval = 30 * time.Second
+
+// poolStats is this node process's PoolStatCollector; NewNode starts it
+// for the node's own NodeID. pkg/scheduler.FreeBytesByNode reads the
+// ZFSNode CRs this writes to, cluster-wide, from the controller process.
+var poolStats = NewPoolStatCollector(DefaultPoolStatInterval)
+
+// PoolStatCollector periodically shells out to `zfs list` on this host
+// and reports the free/used bytes of every pool found back to this
+// node's own ZFSNode CR, via zfs.UpdateNodePools. It runs only on the
+// node server, never the controller - it's the only process with local
+// ZFS visibility into this host's pools.
+type PoolStatCollector struct {
+	interval time.Duration
+	mutex    sync.Mutex
+	started  bool
+}
+
+// NewPoolStatCollector returns a collector that refreshes at the given
+// interval once StartOnce is called.
+func NewPoolStatCollector(interval time.Duration) *PoolStatCollector {
+	return &PoolStatCollector{interval: interval}
+}
+
+// StartOnce launches the collection loop for nodeID in its own goroutine
+// the first time it's called; later calls are no-ops.
+func (p *PoolStatCollector) StartOnce(stopCh <-chan struct{}, nodeID string) {
+	p.mutex.Lock()
+	if p.started {
+		p.mutex.Unlock()
+		return
+	}
+	p.started = true
+	p.mutex.Unlock()
+
+	go p.start(stopCh, nodeID)
+}
+
+func (p *PoolStatCollector) start(stopCh <-chan struct{}, nodeID string) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.refresh(nodeID)
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// refresh re-reads `zfs list` and replaces this node's ZFSNode.Status.Pools
+// wholesale with what it found.
+func (p *PoolStatCollector) refresh(nodeID string) {
+	out, err := exec.Command("zfs", "list", "-Hp", "-o", "name,available,used").CombinedOutput()
+	if err != nil {
+		klog.Errorf("poolstat: zfs list failed : %s, %s", err.Error(), string(out))
+		return
+	}
+
+	if err := zfs.UpdateNodePools(nodeID, parsePoolStats(string(out))); err != nil {
+		klog.Errorf("poolstat: update ZFSNode %s failed : %s", nodeID, err.Error())
+	}
+}
+
+// parsePoolStats turns `zfs list -Hp -o name,available,used` output into
+// one PoolStat per top-level pool, skipping dataset sub-entries (which
+// contain a "/" in their name) and any line that doesn't parse cleanly -
+// a single malformed line from an unrelated dataset shouldn't take down
+// reporting for every pool on the host.
+func parsePoolStats(out string) []zfs.PoolStat {
+	var stats []zfs.PoolStat
+
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+
+		name := fields[0]
+		if strings.Contains(name, "/") {
+			continue
+		}
+
+		free, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		used, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		stats = append(stats, zfs.PoolStat{Name: name, Free: free, Used: used})
+	}
+
+	return stats
+}
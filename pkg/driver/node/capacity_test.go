@@ -0,0 +1,63 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"testing"
+)
+
+// TestParsePoolStatsSkipsDatasets checks that dataset sub-entries (which
+// `zfs list` reports on their own line, nested under their pool via a
+// "/" in the name) are excluded from the pool-level stats.
+func TestParsePoolStatsSkipsDatasets(t *testing.T) {
+	out := "zfspv-pool\t1000\t2000\n" +
+		"zfspv-pool/pvc-1\t500\t100\n"
+
+	stats := parsePoolStats(out)
+	if len(stats) != 1 {
+		t.Fatalf("expected 1 pool stat, got %d : %+v", len(stats), stats)
+	}
+	if stats[0].Name != "zfspv-pool" || stats[0].Free != 1000 || stats[0].Used != 2000 {
+		t.Fatalf("unexpected stat: %+v", stats[0])
+	}
+}
+
+// TestParsePoolStatsSkipsMalformedLines checks that a malformed line
+// (missing a field, non-numeric bytes) is skipped rather than aborting
+// the whole parse or panicking.
+func TestParsePoolStatsSkipsMalformedLines(t *testing.T) {
+	out := "zfspv-pool\t1000\t2000\n" +
+		"short-line\t1000\n" +
+		"bad-numbers\tnot-a-number\tused\n" +
+		"\n"
+
+	stats := parsePoolStats(out)
+	if len(stats) != 1 {
+		t.Fatalf("expected 1 pool stat, got %d : %+v", len(stats), stats)
+	}
+	if stats[0].Name != "zfspv-pool" {
+		t.Fatalf("unexpected stat: %+v", stats[0])
+	}
+}
+
+// TestParsePoolStatsEmptyOutput checks that empty `zfs list` output
+// (no pools on this host) returns no stats rather than erroring.
+func TestParsePoolStatsEmptyOutput(t *testing.T) {
+	if stats := parsePoolStats(""); len(stats) != 0 {
+		t.Fatalf("expected no stats, got %+v", stats)
+	}
+}
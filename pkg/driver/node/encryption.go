@@ -0,0 +1,173 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/openebs/zfs-localpv/pkg/kms"
+	zfs "github.com/openebs/zfs-localpv/pkg/zfs"
+)
+
+// DefaultKeyReconcileInterval is how often KeyReconciler checks this
+// node's encrypted ZFSVolumes for newly-pending keys to stage or an
+// edited encryptionKMS to rotate.
+const DefaultKeyReconcileInterval = 30 * time.Second
+
+// keyReconciler is this node process's KeyReconciler; NewNode starts it
+// for the node's own NodeID.
+var keyReconciler = NewKeyReconciler(DefaultKeyReconcileInterval)
+
+// KeyReconciler is the node-local stand-in for the "ZV reconciler"
+// chunk0-4 was written against: it watches this node's own ZFSVolumes
+// for encryptionKMS and stages/rotates DEKs accordingly. There's no
+// separate control plane for this - it runs as part of the node server
+// process, since staging a key and running `zfs change-key` both have to
+// happen on the host that actually owns the dataset.
+type KeyReconciler struct {
+	interval time.Duration
+
+	mutex   sync.Mutex
+	started bool
+	lastKMS map[string]string // volume name -> encryptionKMS last reconciled
+	staged  map[string]bool   // volume name -> key written to tmpfs, not yet wiped
+}
+
+// NewKeyReconciler returns a reconciler that checks at the given
+// interval once StartOnce is called.
+func NewKeyReconciler(interval time.Duration) *KeyReconciler {
+	return &KeyReconciler{
+		interval: interval,
+		lastKMS:  map[string]string{},
+		staged:   map[string]bool{},
+	}
+}
+
+// StartOnce launches the reconcile loop for nodeID in its own goroutine
+// the first time it's called; later calls are no-ops.
+func (r *KeyReconciler) StartOnce(stopCh <-chan struct{}, nodeID string) {
+	r.mutex.Lock()
+	if r.started {
+		r.mutex.Unlock()
+		return
+	}
+	r.started = true
+	r.mutex.Unlock()
+
+	go r.start(stopCh, nodeID)
+}
+
+func (r *KeyReconciler) start(stopCh <-chan struct{}, nodeID string) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.reconcile(nodeID)
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// reconcile stages a DEK for every encrypted volume owned by nodeID that
+// doesn't have one staged yet, rotates the key (via zfs.RekeyVolume) for
+// any volume whose encryptionKMS changed since the last pass, and wipes
+// the tmpfs copy once a staged volume reaches Ready - the `zfs create`/
+// `zfs change-key` that needed it has, by then, already run. r.staged
+// tracks whether a volume's key is currently on tmpfs awaiting that
+// wipe, independently of r.lastKMS, so the wipe isn't skipped just
+// because this isn't reconcile's first time seeing the volume.
+func (r *KeyReconciler) reconcile(nodeID string) {
+	ctx := context.Background()
+
+	vols, err := zfs.ListZFSVolumesByNode(nodeID)
+	if err != nil {
+		klog.Errorf("key reconciler: list volumes for node %s failed : %s", nodeID, err.Error())
+		return
+	}
+
+	for _, vol := range vols {
+		kmsName := vol.Spec.EncryptionKMS
+		if kmsName == "" {
+			continue
+		}
+
+		r.mutex.Lock()
+		last, seen := r.lastKMS[vol.Name]
+		staged := r.staged[vol.Name]
+		r.mutex.Unlock()
+
+		nowStaged := staged
+		switch {
+		case vol.Status.State == zfs.ZFSStatusReady && seen && last != kmsName:
+			if err := r.stageAndRekey(ctx, vol, kmsName); err != nil {
+				klog.Errorf("key reconciler: rotate %s failed : %s", vol.Name, err.Error())
+				continue
+			}
+			nowStaged = false
+		case vol.Status.State == zfs.ZFSStatusReady && staged:
+			// the key we staged while this volume was Pending has
+			// already been consumed by zfs create; wipe it.
+			if err := zfs.WipeVolumeKey(vol.Name); err != nil {
+				klog.Errorf("key reconciler: wipe key for %s failed : %s", vol.Name, err.Error())
+			}
+			nowStaged = false
+		case vol.Status.State == zfs.ZFSStatusPending && !staged:
+			if err := stageVolumeKey(ctx, kmsName, vol.Name); err != nil {
+				klog.Errorf("key reconciler: stage key for %s failed : %s", vol.Name, err.Error())
+				continue
+			}
+			nowStaged = true
+		}
+
+		r.mutex.Lock()
+		r.lastKMS[vol.Name] = kmsName
+		r.staged[vol.Name] = nowStaged
+		r.mutex.Unlock()
+	}
+}
+
+func (r *KeyReconciler) stageAndRekey(ctx context.Context, vol *zfs.ZFSVolume, kmsName string) error {
+	if err := stageVolumeKey(ctx, kmsName, vol.Name); err != nil {
+		return err
+	}
+	if err := zfs.RekeyVolume(vol, zfs.KeyLocation(vol.Name)); err != nil {
+		return err
+	}
+	return zfs.WipeVolumeKey(vol.Name)
+}
+
+// stageVolumeKey resolves volName's DEK from the named KMS backend and
+// writes it to this node's tmpfs key path. The controller validates
+// kmsName resolves to a configured backend at CreateVolume time (see
+// pkg/driver/controller/encryption.go); this independently re-resolves
+// the same (kmsName, volName) pair so the raw key never has to cross
+// from the controller process to this one.
+func stageVolumeKey(ctx context.Context, kmsName, volName string) error {
+	key, err := kms.Resolve(ctx, kmsName, volName)
+	if err != nil {
+		return err
+	}
+	return zfs.PushVolumeKey(volName, key)
+}
@@ -0,0 +1,173 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog"
+
+	zfs "github.com/openebs/zfs-localpv/pkg/zfs"
+)
+
+// healthReconciler is this node's volume health cache. It runs locally:
+// since NodeGetVolumeStats and healthPusher both already execute on the
+// node that owns the volume, there's no gRPC hop needed to get a probe
+// result here.
+var healthReconciler = zfs.NewHealthReconciler(zfs.DefaultHealthTTL)
+
+// DefaultHealthPushInterval is how often healthPusher re-probes this
+// node's own ZFSVolumes and pushes the verdict to their CR status.
+const DefaultHealthPushInterval = 30 * time.Second
+
+// healthPusher is this node process's HealthPusher; NewNode starts it
+// for the node's own NodeID.
+var healthPusher = NewHealthPusher(DefaultHealthPushInterval)
+
+// HealthPusher probes the pool/dataset health of every ZFSVolume owned
+// by this node and writes the verdict back to that volume's own CR
+// status via zfs.UpdateVolumeHealth. ControllerGetVolume reads that
+// cached status rather than probing itself, since the controller process
+// has no business having ZFS visibility into a pool it doesn't own.
+type HealthPusher struct {
+	interval time.Duration
+
+	mutex   sync.Mutex
+	started bool
+}
+
+// NewHealthPusher returns a pusher that probes at the given interval
+// once StartOnce is called.
+func NewHealthPusher(interval time.Duration) *HealthPusher {
+	return &HealthPusher{interval: interval}
+}
+
+// StartOnce launches the push loop for nodeID in its own goroutine the
+// first time it's called; later calls are no-ops.
+func (p *HealthPusher) StartOnce(stopCh <-chan struct{}, nodeID string) {
+	p.mutex.Lock()
+	if p.started {
+		p.mutex.Unlock()
+		return
+	}
+	p.started = true
+	p.mutex.Unlock()
+
+	go p.start(stopCh, nodeID)
+}
+
+func (p *HealthPusher) start(stopCh <-chan struct{}, nodeID string) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.push(nodeID)
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (p *HealthPusher) push(nodeID string) {
+	vols, err := zfs.ListZFSVolumesByNode(nodeID)
+	if err != nil {
+		klog.Errorf("health pusher: list volumes for node %s failed : %s", nodeID, err.Error())
+		return
+	}
+
+	for _, vol := range vols {
+		dataset := zfs.DatasetName(vol.Spec.PoolName, vol.Name)
+		h := healthReconciler.Check(vol.Name, vol.Spec.PoolName, dataset)
+
+		if err := zfs.UpdateVolumeHealth(vol.Name, h); err != nil {
+			klog.Errorf("health pusher: update health for %s failed : %s", vol.Name, err.Error())
+		}
+	}
+}
+
+// NodeGetVolumeStats reports usage and health for a published volume.
+// VolumeCondition.Abnormal is set when the target path's mountpoint is
+// missing, or when the backing dataset is read-only/suspended when it
+// shouldn't be.
+//
+// This implements csi.NodeServer
+func (ns *node) NodeGetVolumeStats(
+	ctx context.Context,
+	req *csi.NodeGetVolumeStatsRequest,
+) (*csi.NodeGetVolumeStatsResponse, error) {
+
+	volumeID := req.GetVolumeId()
+	volumePath := req.GetVolumePath()
+	if volumeID == "" || volumePath == "" {
+		return nil, status.Error(codes.InvalidArgument, "NodeGetVolumeStats: missing volume id or volume path")
+	}
+
+	if _, err := os.Stat(volumePath); err != nil {
+		return &csi.NodeGetVolumeStatsResponse{
+			VolumeCondition: &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  "volume path is not mounted : " + err.Error(),
+			},
+		}, nil
+	}
+
+	vol, err := zfs.GetZFSVolume(volumeID)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "NodeGetVolumeStats: %s", err.Error())
+	}
+
+	dataset := zfs.DatasetName(vol.Spec.PoolName, vol.Name)
+
+	h, ok := healthReconciler.Health(volumeID)
+	if !ok {
+		h = healthReconciler.Check(volumeID, vol.Spec.PoolName, dataset)
+	}
+
+	var stat unix.Statfs_t
+	if err := unix.Statfs(volumePath, &stat); err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeGetVolumeStats: statfs %s : %s", volumePath, err.Error())
+	}
+
+	total := int64(stat.Blocks) * int64(stat.Bsize)
+	avail := int64(stat.Bavail) * int64(stat.Bsize)
+	used := total - (int64(stat.Bfree) * int64(stat.Bsize))
+
+	return &csi.NodeGetVolumeStatsResponse{
+		Usage: []*csi.VolumeUsage{
+			{
+				Unit:      csi.VolumeUsage_BYTES,
+				Total:     total,
+				Available: avail,
+				Used:      used,
+			},
+		},
+		VolumeCondition: &csi.VolumeCondition{
+			Abnormal: h.Abnormal,
+			Message:  h.Message,
+		},
+	}, nil
+}
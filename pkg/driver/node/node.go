@@ -0,0 +1,203 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/openebs/zfs-localpv/pkg/common/log"
+	zfs "github.com/openebs/zfs-localpv/pkg/zfs"
+)
+
+// Config holds the bits of driver identity the node server needs. Node
+// identity (NodeID) lives here rather than on
+// pkg/driver/controller.Config, since the controller server never reads
+// it.
+type Config struct {
+	NodeID string
+}
+
+// node is the server implementation for CSI Node.
+type node struct {
+	config       *Config
+	capabilities []*csi.NodeServiceCapability
+}
+
+// NewNode returns a new instance of the CSI node server.
+func NewNode(c *Config) csi.NodeServer {
+	keyReconciler.StartOnce(make(chan struct{}), c.NodeID)
+	poolStats.StartOnce(make(chan struct{}), c.NodeID)
+	healthPusher.StartOnce(make(chan struct{}), c.NodeID)
+
+	return &node{
+		config:       c,
+		capabilities: newNodeCapabilities(),
+	}
+}
+
+func newNodeCapabilities() []*csi.NodeServiceCapability {
+	fromType := func(c csi.NodeServiceCapability_RPC_Type) *csi.NodeServiceCapability {
+		return &csi.NodeServiceCapability{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{Type: c},
+			},
+		}
+	}
+
+	var capabilities []*csi.NodeServiceCapability
+	for _, c := range []csi.NodeServiceCapability_RPC_Type{
+		csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+		csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+		csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+		csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+	} {
+		capabilities = append(capabilities, fromType(c))
+	}
+	return capabilities
+}
+
+// NodeGetCapabilities returns the capabilities of this node server.
+//
+// This implements csi.NodeServer
+func (ns *node) NodeGetCapabilities(
+	ctx context.Context,
+	req *csi.NodeGetCapabilitiesRequest,
+) (*csi.NodeGetCapabilitiesResponse, error) {
+	return &csi.NodeGetCapabilitiesResponse{
+		Capabilities: ns.capabilities,
+	}, nil
+}
+
+// NodeGetInfo returns this node's ID and topology, so the external
+// provisioner can pick a node whose pool satisfies the requested
+// StorageClass.
+//
+// This implements csi.NodeServer
+func (ns *node) NodeGetInfo(
+	ctx context.Context,
+	req *csi.NodeGetInfoRequest,
+) (*csi.NodeGetInfoResponse, error) {
+	return &csi.NodeGetInfoResponse{
+		NodeId: ns.config.NodeID,
+		AccessibleTopology: &csi.Topology{
+			Segments: map[string]string{
+				zfs.ZFSTopologyKey: ns.config.NodeID,
+			},
+		},
+	}, nil
+}
+
+// NodeStageVolume is otherwise a no-op: ZFS datasets are mounted directly
+// at their target path by NodePublishVolume, there's no separate staging
+// mount. For an encrypted volume, though, this is where its DEK gets
+// staged on this host - CreateVolume passes the encryptionKMS parameter
+// through via VolumeContext (see pkg/zfs.EncryptionKMSKey) precisely so
+// the node that will run `zfs create` can fetch and write the key here
+// before that happens. KeyReconciler also stages it on a timer as a
+// backstop for volumes republished without ever calling NodeStageVolume
+// again, so a failure here isn't fatal to provisioning.
+//
+// This implements csi.NodeServer
+func (ns *node) NodeStageVolume(
+	ctx context.Context,
+	req *csi.NodeStageVolumeRequest,
+) (*csi.NodeStageVolumeResponse, error) {
+	if kmsName := req.GetVolumeContext()[zfs.EncryptionKMSKey]; kmsName != "" {
+		if err := stageVolumeKey(ctx, kmsName, req.GetVolumeId()); err != nil {
+			return nil, status.Errorf(codes.Internal, "NodeStageVolume: %s", err.Error())
+		}
+	}
+	return &csi.NodeStageVolumeResponse{}, nil
+}
+
+// NodeUnstageVolume is a no-op for the same reason as NodeStageVolume.
+//
+// This implements csi.NodeServer
+func (ns *node) NodeUnstageVolume(
+	ctx context.Context,
+	req *csi.NodeUnstageVolumeRequest,
+) (*csi.NodeUnstageVolumeResponse, error) {
+	return &csi.NodeUnstageVolumeResponse{}, nil
+}
+
+// NodePublishVolume mounts the ZFS dataset backing the volume at the
+// requested target path.
+//
+// This implements csi.NodeServer
+func (ns *node) NodePublishVolume(
+	ctx context.Context,
+	req *csi.NodePublishVolumeRequest,
+) (*csi.NodePublishVolumeResponse, error) {
+	volumeID := req.GetVolumeId()
+	targetPath := req.GetTargetPath()
+
+	if volumeID == "" || targetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "NodePublishVolume: missing volume id or target path")
+	}
+
+	if err := zfs.MountVolume(volumeID, targetPath, req.GetVolumeCapability()); err != nil {
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume: %s", err.Error())
+	}
+
+	log.DefaultLog(ctx, "mounted volume {%s} at {%s}", volumeID, targetPath)
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// NodeUnpublishVolume unmounts the volume from the given target path.
+//
+// This implements csi.NodeServer
+func (ns *node) NodeUnpublishVolume(
+	ctx context.Context,
+	req *csi.NodeUnpublishVolumeRequest,
+) (*csi.NodeUnpublishVolumeResponse, error) {
+	volumeID := req.GetVolumeId()
+	targetPath := req.GetTargetPath()
+
+	if volumeID == "" || targetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "NodeUnpublishVolume: missing volume id or target path")
+	}
+
+	if err := zfs.UmountVolume(volumeID, targetPath); err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeUnpublishVolume: %s", err.Error())
+	}
+
+	log.DefaultLog(ctx, "unmounted volume {%s} from {%s}", volumeID, targetPath)
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+// NodeExpandVolume grows the filesystem on top of a ZFS dataset after
+// ControllerExpandVolume has grown the dataset itself.
+//
+// This implements csi.NodeServer
+func (ns *node) NodeExpandVolume(
+	ctx context.Context,
+	req *csi.NodeExpandVolumeRequest,
+) (*csi.NodeExpandVolumeResponse, error) {
+	volumeID := req.GetVolumeId()
+	if volumeID == "" {
+		return nil, status.Error(codes.InvalidArgument, "NodeExpandVolume: missing volume id")
+	}
+
+	if err := zfs.ResizeFS(volumeID); err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeExpandVolume: %s", err.Error())
+	}
+
+	return &csi.NodeExpandVolumeResponse{}, nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kms
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// ConfigMapName is the cluster-wide ConfigMap mapping an `encryptionKMS`
+// StorageClass parameter to a KMS backend and its config.
+const ConfigMapName = "openebs-zfs-kms-config"
+
+// DefaultNamespace is used when OPENEBS_NAMESPACE isn't set, matching the
+// default install namespace of the other zfs-localpv components.
+const DefaultNamespace = "openebs"
+
+// configMapEntry is one named KMS config, as authored by the operator in
+// ConfigMapName, e.g. a Data entry named "myvault" might hold:
+//
+//	provider: vault
+//	address: https://vault:8200
+//	mount: transit
+//	keyName: zfs-localpv
+type configMapEntry struct {
+	Provider string            `yaml:"provider"`
+	Config   map[string]string `yaml:",inline"`
+}
+
+// LoadFromConfigMap resolves the named kms entry from ConfigMapName in
+// the operator's namespace and builds the configured KMSProvider.
+func LoadFromConfigMap(ctx context.Context, name string) (KMSProvider, error) {
+	client, err := inClusterClient()
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := os.Getenv("OPENEBS_NAMESPACE")
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configmap %s/%s : %s", namespace, ConfigMapName, err.Error())
+	}
+
+	raw, ok := cm.Data[name]
+	if !ok {
+		return nil, fmt.Errorf("no entry %q in configmap %s/%s", name, namespace, ConfigMapName)
+	}
+
+	var entry configMapEntry
+	if err := yaml.Unmarshal([]byte(raw), &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse kms entry %q : %s", name, err.Error())
+	}
+
+	return New(entry.Provider, entry.Config)
+}
+
+func inClusterClient() (kubernetes.Interface, error) {
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build in-cluster config : %s", err.Error())
+	}
+	return kubernetes.NewForConfig(cfg)
+}
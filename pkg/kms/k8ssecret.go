@@ -0,0 +1,67 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kms
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	Register("k8s-secret", newK8sSecretProvider)
+}
+
+// k8sSecretProvider reads the DEK straight out of a Kubernetes Secret.
+// Its config names the secret to read from; one secret can hold keys for
+// multiple volumes, each under its own data key.
+type k8sSecretProvider struct {
+	namespace string
+	secret    string
+}
+
+func newK8sSecretProvider(config map[string]string) (KMSProvider, error) {
+	namespace := config["namespace"]
+	secret := config["secret"]
+	if namespace == "" || secret == "" {
+		return nil, fmt.Errorf("k8s-secret: namespace and secret are required")
+	}
+	return &k8sSecretProvider{namespace: namespace, secret: secret}, nil
+}
+
+func (p *k8sSecretProvider) GetKey(ctx context.Context, keyID string) ([]byte, error) {
+	client, err := inClusterClient()
+	if err != nil {
+		return nil, err
+	}
+
+	sec, err := client.CoreV1().Secrets(p.namespace).Get(ctx, p.secret, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("k8s-secret: failed to read %s/%s : %s", p.namespace, p.secret, err.Error())
+	}
+
+	// secret data keys can't contain "/", so volume names are escaped
+	// the same way going in as coming out
+	dataKey := strings.ReplaceAll(keyID, "/", "_")
+	key, ok := sec.Data[dataKey]
+	if !ok {
+		return nil, fmt.Errorf("k8s-secret: no key %q in %s/%s", dataKey, p.namespace, p.secret)
+	}
+	return key, nil
+}
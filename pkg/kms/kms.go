@@ -0,0 +1,73 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kms lets the ZFS driver fetch or derive per-volume
+// data-encryption-keys (DEKs) from an external key manager, instead of
+// requiring operators to pre-stage raw key files on every node.
+package kms
+
+import (
+	"context"
+	"fmt"
+)
+
+// KMSProvider abstracts a backend capable of producing the raw bytes of a
+// per-volume DEK, so the driver doesn't care whether the key lives in a
+// Kubernetes Secret, Vault, or AWS KMS.
+type KMSProvider interface {
+	// GetKey returns the raw DEK bytes for keyID -- fetched as-is
+	// (Kubernetes Secrets, AWS KMS) or derived/unwrapped (Vault Transit).
+	GetKey(ctx context.Context, keyID string) ([]byte, error)
+}
+
+// providers holds the constructor registered by each backend, keyed by
+// the `provider` field of a kms ConfigMap entry.
+var providers = map[string]func(config map[string]string) (KMSProvider, error){}
+
+// Register adds a provider constructor under the given backend name. It
+// is meant to be called from each provider's init().
+func Register(name string, ctor func(config map[string]string) (KMSProvider, error)) {
+	providers[name] = ctor
+}
+
+// New builds the named provider from its config section.
+func New(name string, config map[string]string) (KMSProvider, error) {
+	ctor, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("kms: unknown provider %q", name)
+	}
+	return ctor(config)
+}
+
+// Resolve loads the named backend from the kms ConfigMap and fetches
+// keyID's DEK from it. Both the controller (to validate an
+// encryptionKMS StorageClass parameter at CreateVolume time) and the
+// node (to stage the actual key bytes on its own filesystem) call this
+// with the same (kmsName, volume name) pair, so they derive the same key
+// independently rather than one process having to hand key material to
+// the other.
+func Resolve(ctx context.Context, kmsName, keyID string) ([]byte, error) {
+	provider, err := LoadFromConfigMap(ctx, kmsName)
+	if err != nil {
+		return nil, fmt.Errorf("kms: resolve %q for %s : %s", kmsName, keyID, err.Error())
+	}
+
+	key, err := provider.GetKey(ctx, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("kms: resolve %q for %s : %s", kmsName, keyID, err.Error())
+	}
+	return key, nil
+}
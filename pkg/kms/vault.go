@@ -0,0 +1,124 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+func init() {
+	Register("vault", newVaultProvider)
+}
+
+// vaultProvider fetches DEKs from HashiCorp Vault, either by reading them
+// straight out of a KV v2 secret engine ("engine: kv-v2", the default),
+// or by asking Vault's Transit engine to mint a fresh per-volume data key
+// wrapped under a server-side master key ("engine: transit").
+type vaultProvider struct {
+	client *vaultapi.Client
+	engine string
+	mount  string
+	path   string // KV v2 path prefix, when engine == "kv-v2"
+	key    string // transit key name, when engine == "transit"
+}
+
+func newVaultProvider(config map[string]string) (KMSProvider, error) {
+	cfg := vaultapi.DefaultConfig()
+	if addr := config["address"]; addr != "" {
+		cfg.Address = addr
+	}
+
+	client, err := vaultapi.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to build client : %s", err.Error())
+	}
+	if token := config["token"]; token != "" {
+		client.SetToken(token)
+	}
+
+	engine := config["engine"]
+	if engine == "" {
+		engine = "kv-v2"
+	}
+
+	return &vaultProvider{
+		client: client,
+		engine: engine,
+		mount:  config["mount"],
+		path:   config["path"],
+		key:    config["keyName"],
+	}, nil
+}
+
+func (p *vaultProvider) GetKey(ctx context.Context, keyID string) ([]byte, error) {
+	if p.engine == "transit" {
+		return p.transitDataKey(ctx, keyID)
+	}
+	return p.kvV2Key(ctx, keyID)
+}
+
+// kvV2Key reads a static, pre-staged key out of a KV v2 secret engine,
+// from <mount>/data/<path>/<keyID>, data field "key" (base64).
+func (p *vaultProvider) kvV2Key(ctx context.Context, keyID string) ([]byte, error) {
+	secretPath := fmt.Sprintf("%s/data/%s/%s", p.mount, p.path, keyID)
+
+	secret, err := p.client.Logical().ReadWithContext(ctx, secretPath)
+	if err != nil || secret == nil {
+		return nil, fmt.Errorf("vault: failed to read %s : %v", secretPath, err)
+	}
+
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("vault: malformed kv-v2 response at %s", secretPath)
+	}
+
+	encoded, ok := data["key"].(string)
+	if !ok {
+		return nil, fmt.Errorf("vault: no \"key\" field at %s", secretPath)
+	}
+
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// transitDataKey asks Transit to mint a fresh plaintext data key under
+// p.key, scoped to keyID via Transit's derivation context so the same
+// master key can serve every volume without the operator pre-staging
+// anything. Vault's own audit log is the source of truth for what was
+// issued; zfs-localpv doesn't need to persist the ciphertext locally
+// because RekeyVolume just requests a new data key rather than unwrapping
+// a stored one.
+func (p *vaultProvider) transitDataKey(ctx context.Context, keyID string) ([]byte, error) {
+	reqPath := fmt.Sprintf("%s/datakey/plaintext/%s", p.mount, p.key)
+
+	secret, err := p.client.Logical().WriteWithContext(ctx, reqPath, map[string]interface{}{
+		"context": base64.StdEncoding.EncodeToString([]byte(keyID)),
+	})
+	if err != nil || secret == nil {
+		return nil, fmt.Errorf("vault: transit datakey request failed : %v", err)
+	}
+
+	encoded, ok := secret.Data["plaintext"].(string)
+	if !ok {
+		return nil, fmt.Errorf("vault: transit response missing plaintext")
+	}
+
+	return base64.StdEncoding.DecodeString(encoded)
+}
@@ -0,0 +1,51 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/openebs/zfs-localpv/pkg/zfs"
+)
+
+// FreeBytesByNode aggregates the given pool's free bytes across every
+// ZFSNode CR that reports it, keyed by node name. getNodeMap uses this to
+// build the "capacity" scheduler's candidate map, and GetCapacity uses it
+// to report available bytes for the requested topology.
+//
+// ZFSNode.Status.Pools is kept up to date by each node's own
+// pkg/driver/node pool-stat collector (see node/capacity.go), which
+// periodically shells out to `zfs list` locally and writes the result
+// back to that node's own ZFSNode CR via zfs.UpdateNodePools - this
+// function only ever reads, it never execs anything itself, so it gives
+// a real cluster-wide view rather than just the controller's own host.
+func FreeBytesByNode(pool string) (map[string]int64, error) {
+	nodes, err := zfs.ListZFSNodes()
+	if err != nil {
+		return nil, fmt.Errorf("poolstat: list zfs nodes failed : %s", err.Error())
+	}
+
+	nmap := map[string]int64{}
+	for _, n := range nodes {
+		for _, ps := range n.Status.Pools {
+			if ps.Name == pool {
+				nmap[n.Name] = ps.Free
+			}
+		}
+	}
+	return nmap, nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// scheduling modes accepted via the `scheduler` StorageClass parameter
+const (
+	// ScheduleSpread is the default mode : it balances volumes across the
+	// nodes/pools that already have the fewest ZFSVolumes provisioned on
+	// them.
+	ScheduleSpread = "spread"
+
+	// ScheduleCapacity places the volume on the node/pool that currently
+	// reports the most free space, per the pool-stat collector.
+	ScheduleCapacity = "capacity"
+)
+
+// Scheduler picks the best node for a new volume out of the candidates in
+// nmap.
+//
+// For ScheduleSpread (and the default, empty mode) nmap holds the number
+// of volumes already provisioned on each node/pool, and the node with the
+// lowest count wins. For ScheduleCapacity nmap holds free bytes per
+// node/pool, as populated by getNodeMap from the pool-stat collector, and
+// the node with the most free space wins.
+func Scheduler(req *csi.CreateVolumeRequest, nmap map[string]int64, mode string) string {
+	var selected string
+
+	switch mode {
+	case ScheduleCapacity:
+		var maxFree int64 = -1
+		for node, free := range nmap {
+			if free > maxFree {
+				maxFree = free
+				selected = node
+			}
+		}
+	default:
+		var minCount int64 = -1
+		for node, count := range nmap {
+			if minCount == -1 || count < minCount {
+				minCount = count
+				selected = node
+			}
+		}
+	}
+
+	return selected
+}
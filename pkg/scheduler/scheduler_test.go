@@ -0,0 +1,68 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// TestSchedulerSpreadPicksLowestCount checks the default/ScheduleSpread
+// mode picks the node with the fewest volumes already provisioned.
+func TestSchedulerSpreadPicksLowestCount(t *testing.T) {
+	nmap := map[string]int64{"node-a": 5, "node-b": 1, "node-c": 3}
+
+	selected := Scheduler(&csi.CreateVolumeRequest{}, nmap, ScheduleSpread)
+	if selected != "node-b" {
+		t.Fatalf("expected node-b, got %s", selected)
+	}
+}
+
+// TestSchedulerDefaultModeBehavesLikeSpread checks that an empty/unknown
+// mode string falls back to the spread behavior, since that's the
+// documented default for the `scheduler` StorageClass parameter.
+func TestSchedulerDefaultModeBehavesLikeSpread(t *testing.T) {
+	nmap := map[string]int64{"node-a": 5, "node-b": 1}
+
+	selected := Scheduler(&csi.CreateVolumeRequest{}, nmap, "")
+	if selected != "node-b" {
+		t.Fatalf("expected node-b, got %s", selected)
+	}
+}
+
+// TestSchedulerCapacityPicksMostFree checks ScheduleCapacity picks the
+// node reporting the most free bytes.
+func TestSchedulerCapacityPicksMostFree(t *testing.T) {
+	nmap := map[string]int64{"node-a": 100, "node-b": 900, "node-c": 500}
+
+	selected := Scheduler(&csi.CreateVolumeRequest{}, nmap, ScheduleCapacity)
+	if selected != "node-b" {
+		t.Fatalf("expected node-b, got %s", selected)
+	}
+}
+
+// TestSchedulerEmptyMapReturnsEmpty checks that an empty candidate map
+// (e.g. no ZFSNode has reported any pool stats yet) fails safe by
+// returning no selection, rather than panicking or picking a zero value.
+func TestSchedulerEmptyMapReturnsEmpty(t *testing.T) {
+	for _, mode := range []string{ScheduleSpread, ScheduleCapacity} {
+		if selected := Scheduler(&csi.CreateVolumeRequest{}, map[string]int64{}, mode); selected != "" {
+			t.Fatalf("mode %s: expected empty selection for empty nmap, got %s", mode, selected)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package zfs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// EncryptionKMSKey is the VolumeContext key CreateVolume uses to pass the
+// `encryptionKMS` StorageClass parameter through to the node, the same
+// way PoolNameKey passes the pool. NodeStageVolume reads it to know
+// whether it needs to stage a KMS-derived key before the dataset is
+// created.
+const EncryptionKMSKey = "encryptionKMS"
+
+// TmpfsKeyDir is where per-volume DEKs are staged on the owner node
+// before `zfs create`/`zfs change-key` consume them. It must be a tmpfs
+// mount so keys never touch persistent storage.
+const TmpfsKeyDir = "/run/zfs-localpv/keys"
+
+// KeyPath returns the tmpfs path a volume's staged key is written to.
+func KeyPath(volName string) string {
+	return TmpfsKeyDir + "/" + volName
+}
+
+// KeyLocation returns the `keylocation=` value ZFS expects for a
+// volume's staged key.
+func KeyLocation(volName string) string {
+	return "file://" + KeyPath(volName)
+}
+
+// PushVolumeKey writes a volume's DEK to its tmpfs key path on this
+// host. Callers must run this on the node that actually owns the
+// volume's pool -- the path is only meaningful on that host's
+// filesystem.
+func PushVolumeKey(volName string, key []byte) error {
+	if err := os.MkdirAll(TmpfsKeyDir, 0700); err != nil {
+		return fmt.Errorf("push volume key for %s : %s", volName, err.Error())
+	}
+
+	if err := os.WriteFile(KeyPath(volName), key, 0600); err != nil {
+		return fmt.Errorf("push volume key for %s : %s", volName, err.Error())
+	}
+	return nil
+}
+
+// WipeVolumeKey overwrites and removes a volume's staged key file, once
+// whatever `zfs` command needed it has consumed it.
+func WipeVolumeKey(volName string) error {
+	path := KeyPath(volName)
+
+	if info, err := os.Stat(path); err == nil {
+		zeros := make([]byte, info.Size())
+		_ = os.WriteFile(path, zeros, 0600)
+	} else if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("wipe volume key for %s : %s", volName, err.Error())
+	}
+	return nil
+}
+
+// RekeyVolume re-keys the live dataset backing vol with the key staged
+// at keyLocation, via `zfs change-key`, without taking the volume
+// offline. The caller must have already staged the new key with
+// PushVolumeKey and must run this on the volume's owner node.
+func RekeyVolume(vol *ZFSVolume, keyLocation string) error {
+	dataset := DatasetName(vol.Spec.PoolName, vol.Name)
+
+	out, err := exec.Command("zfs", "change-key", "-o", "keylocation="+keyLocation, dataset).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("zfs change-key failed for %s : %s, %s", dataset, err.Error(), string(out))
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package zfs
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHealthTTL is how long a cached health verdict is trusted before
+// ControllerGetVolume/ListVolumes forces a fresh probe instead of serving
+// a stale one.
+const DefaultHealthTTL = 2 * time.Minute
+
+// probeTimeout bounds how long a single zpool/zfs probe command is
+// allowed to run, so a pool with a hung/unresponsive device can't stall
+// the caller indefinitely. Check only ever runs on the node that owns
+// the volume's pool - NodeGetVolumeStats calls it directly, and
+// HealthPusher (pkg/driver/node/health.go) calls it on a timer and
+// writes the verdict to the ZFSVolume's own status via
+// UpdateVolumeHealth, so ControllerGetVolume can read it back without
+// ever executing a probe itself.
+const probeTimeout = 10 * time.Second
+
+// VolumeHealth is the last known health verdict for one ZFSVolume.
+type VolumeHealth struct {
+	Abnormal bool
+	Message  string
+
+	checkedAt time.Time
+}
+
+// HealthReconciler runs `zpool status -x <pool>` and
+// `zfs get -H -o value health,written,used <dataset>` for a volume's
+// pool/dataset and caches the verdict, so that ControllerGetVolume and
+// the node's NodeGetVolumeStats extension don't each have to shell out on
+// every call. Entries older than TTL are treated as unknown (and
+// recomputed on the next Check) rather than served stale.
+type HealthReconciler struct {
+	mutex sync.RWMutex
+	ttl   time.Duration
+	cache map[string]VolumeHealth // volume name -> health
+}
+
+// NewHealthReconciler returns a reconciler that caches verdicts for ttl.
+func NewHealthReconciler(ttl time.Duration) *HealthReconciler {
+	if ttl <= 0 {
+		ttl = DefaultHealthTTL
+	}
+	return &HealthReconciler{
+		ttl:   ttl,
+		cache: map[string]VolumeHealth{},
+	}
+}
+
+// Health returns the cached health for volName, and whether it is still
+// within TTL.
+func (r *HealthReconciler) Health(volName string) (VolumeHealth, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	h, ok := r.cache[volName]
+	if !ok || time.Since(h.checkedAt) > r.ttl {
+		return VolumeHealth{}, false
+	}
+	return h, true
+}
+
+// Check runs the zpool/zfs health probes for the given volume's pool and
+// dataset, caches the verdict, and returns it. Callers (ControllerGetVolume,
+// NodeGetVolumeStats) invoke it directly whenever Health reports no
+// unexpired entry, rather than relying on a separate background loop.
+func (r *HealthReconciler) Check(volName, pool, dataset string) VolumeHealth {
+	h := r.probe(pool, dataset)
+	h.checkedAt = time.Now()
+
+	r.mutex.Lock()
+	r.cache[volName] = h
+	r.mutex.Unlock()
+
+	return h
+}
+
+func (r *HealthReconciler) probe(pool, dataset string) VolumeHealth {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "zpool", "status", "-x", pool).CombinedOutput()
+	if h, ok := parsePoolStatus(string(out), err); !ok {
+		return h
+	}
+
+	out, err = exec.CommandContext(ctx, "zfs", "get", "-H", "-o", "value", "health,written,used", dataset).CombinedOutput()
+	if err != nil {
+		return VolumeHealth{Abnormal: true, Message: strings.TrimSpace(string(out))}
+	}
+
+	return parseDatasetHealth(string(out))
+}
+
+// parsePoolStatus interprets `zpool status -x <pool>` output. It returns
+// (zero, true) when the pool is healthy, so probe should go on to check
+// the dataset itself; otherwise it returns the abnormal verdict to
+// report directly.
+func parsePoolStatus(out string, cmdErr error) (VolumeHealth, bool) {
+	if cmdErr != nil || !strings.Contains(out, "is healthy") {
+		return VolumeHealth{Abnormal: true, Message: strings.TrimSpace(out)}, false
+	}
+	return VolumeHealth{}, true
+}
+
+// parseDatasetHealth interprets the first line of
+// `zfs get -H -o value health,written,used <dataset>` output - anything
+// other than ONLINE (including no output at all, e.g. a missing dataset)
+// is reported abnormal.
+func parseDatasetHealth(out string) VolumeHealth {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) == 0 || !strings.EqualFold(strings.TrimSpace(lines[0]), "ONLINE") {
+		return VolumeHealth{Abnormal: true, Message: "dataset health is not ONLINE : " + strings.TrimSpace(out)}
+	}
+	return VolumeHealth{Abnormal: false}
+}
+
+// DatasetName returns the ZFS dataset backing a volume's pool/name pair,
+// in pool/volume form. Both HealthPusher and NodeGetVolumeStats need
+// this to call Check, so it lives here rather than being duplicated in
+// each package.
+func DatasetName(pool, volName string) string {
+	return pool + "/" + volName
+}
+
+// UpdateVolumeHealth writes a volume's last-probed health verdict to its
+// own ZFSVolume CR status, so ControllerGetVolume can read it back
+// without the controller process ever needing ZFS visibility into a
+// pool it may not own.
+func UpdateVolumeHealth(volName string, h VolumeHealth) error {
+	vol, err := GetZFSVolume(volName)
+	if err != nil {
+		return err
+	}
+
+	vol.Status.HealthAbnormal = h.Abnormal
+	vol.Status.HealthMessage = h.Message
+
+	return UpdateZFSVolume(vol)
+}
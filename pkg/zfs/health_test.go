@@ -0,0 +1,78 @@
+/*
+Copyright © 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package zfs
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestParsePoolStatusHealthy checks that a healthy `zpool status -x`
+// result tells probe to go on and check the dataset itself.
+func TestParsePoolStatusHealthy(t *testing.T) {
+	h, ok := parsePoolStatus("pool 'zfspv-pool' is healthy\n", nil)
+	if !ok {
+		t.Fatalf("expected ok=true for a healthy pool, got %+v", h)
+	}
+}
+
+// TestParsePoolStatusUnhealthy checks that a non-healthy pool (or a
+// failed zpool command) is reported abnormal directly.
+func TestParsePoolStatusUnhealthy(t *testing.T) {
+	h, ok := parsePoolStatus("pool: zfspv-pool\nstate: DEGRADED\n", nil)
+	if ok || !h.Abnormal {
+		t.Fatalf("expected an abnormal verdict, got ok=%v h=%+v", ok, h)
+	}
+}
+
+// TestParsePoolStatusCommandError checks that a zpool command failure is
+// treated as abnormal even if the (empty/partial) output doesn't itself
+// look unhealthy.
+func TestParsePoolStatusCommandError(t *testing.T) {
+	h, ok := parsePoolStatus("", errors.New("exit status 1"))
+	if ok || !h.Abnormal {
+		t.Fatalf("expected an abnormal verdict on command error, got ok=%v h=%+v", ok, h)
+	}
+}
+
+// TestParseDatasetHealthOnline checks that an ONLINE dataset is reported
+// healthy.
+func TestParseDatasetHealthOnline(t *testing.T) {
+	h := parseDatasetHealth("ONLINE\n1048576\n2097152\n")
+	if h.Abnormal {
+		t.Fatalf("expected a healthy verdict, got %+v", h)
+	}
+}
+
+// TestParseDatasetHealthNonOnline checks that any non-ONLINE value
+// (DEGRADED, FAULTED, etc) is reported abnormal.
+func TestParseDatasetHealthNonOnline(t *testing.T) {
+	h := parseDatasetHealth("DEGRADED\n1048576\n2097152\n")
+	if !h.Abnormal {
+		t.Fatalf("expected an abnormal verdict, got %+v", h)
+	}
+}
+
+// TestParseDatasetHealthMissingDataset checks that empty output - what a
+// missing dataset produces - is reported abnormal rather than treated as
+// healthy by default.
+func TestParseDatasetHealthMissingDataset(t *testing.T) {
+	h := parseDatasetHealth("")
+	if !h.Abnormal {
+		t.Fatalf("expected an abnormal verdict for a missing dataset, got %+v", h)
+	}
+}